@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	topicStats = "stats"
+	topicHN    = "hn"
+
+	defaultHeartbeat = 30 * time.Second
+	sessionTTL       = 1 * time.Hour
+)
+
+// Authenticator verifies a client-supplied credential and, on success,
+// returns the topics that credential is allowed to subscribe to. Operators
+// can swap in HMAC-signed tokens, a static shared secret, or an OIDC
+// verifier without touching the SSE handlers.
+type Authenticator interface {
+	Authenticate(credential string) (topics []string, err error)
+}
+
+var errUnauthorized = errors.New("auth: invalid credential")
+
+// StaticKeyAuthenticator accepts any credential present in a fixed allow
+// list, granting it a fixed set of topics. It's the default for local
+// development and small single-operator deployments.
+type StaticKeyAuthenticator struct {
+	Keys map[string][]string // credential -> allowed topics
+}
+
+func (a StaticKeyAuthenticator) Authenticate(credential string) ([]string, error) {
+	topics, ok := a.Keys[credential]
+	if !ok {
+		return nil, errUnauthorized
+	}
+	return topics, nil
+}
+
+// defaultAuthenticator reads a single shared secret from ILLU_SHARED_SECRET
+// so operators can run with auth enabled without writing any Go code.
+// Anything more elaborate (HMAC-signed tokens, OIDC) is a matter of
+// constructing a different Authenticator and assigning it to authenticator
+// in main.
+func defaultAuthenticator() Authenticator {
+	secret := os.Getenv("ILLU_SHARED_SECRET")
+	if secret == "" {
+		secret = "dev"
+	}
+	return StaticKeyAuthenticator{
+		Keys: map[string][]string{
+			secret: {topicStats, topicHN},
+		},
+	}
+}
+
+var authenticator Authenticator = defaultAuthenticator()
+
+// session is what the server remembers about an authenticated client
+// between the /auth handshake and its SSE connection(s), modeled on goim's
+// OP_AUTH flow: one handshake issues an opaque subKey that subsequent
+// stream connections present instead of re-authenticating.
+type session struct {
+	subKey    string
+	topics    map[string]struct{}
+	heartbeat time.Duration
+	expiresAt time.Time
+}
+
+func (s *session) allows(topic string) bool {
+	_, ok := s.topics[topic]
+	return ok
+}
+
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: make(map[string]*session)}
+}
+
+func (s *sessionStore) create(topics []string, heartbeat time.Duration) (*session, error) {
+	subKey, err := newSubKey()
+	if err != nil {
+		return nil, err
+	}
+
+	topicSet := make(map[string]struct{}, len(topics))
+	for _, t := range topics {
+		topicSet[t] = struct{}{}
+	}
+
+	sess := &session{
+		subKey:    subKey,
+		topics:    topicSet,
+		heartbeat: heartbeat,
+		expiresAt: time.Now().Add(sessionTTL),
+	}
+
+	s.mu.Lock()
+	s.sessions[subKey] = sess
+	s.mu.Unlock()
+	return sess, nil
+}
+
+// get returns the session for subKey, evicting it first if it has expired.
+func (s *sessionStore) get(subKey string) (*session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[subKey]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(sess.expiresAt) {
+		delete(s.sessions, subKey)
+		return nil, false
+	}
+	return sess, true
+}
+
+// sweep drops every expired session, regardless of whether it's ever looked
+// up again by get. Without this, a session whose owner authenticates but
+// never connects (or connects once and leaves) lingers in the map forever,
+// since nothing else would ever evict it.
+func (s *sessionStore) sweep() {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for subKey, sess := range s.sessions {
+		if now.After(sess.expiresAt) {
+			delete(s.sessions, subKey)
+		}
+	}
+}
+
+// runSweeper periodically sweeps expired sessions until stop is closed.
+// It's meant to be started exactly once, as its own goroutine, for the
+// lifetime of the process.
+func (s *sessionStore) runSweeper(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.sweep()
+		case <-stop:
+			return
+		}
+	}
+}
+
+const sessionSweepInterval = 5 * time.Minute
+
+var sessions = newSessionStore()
+
+func newSubKey() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+type authRequest struct {
+	Credential string `json:"credential"`
+}
+
+type authResponse struct {
+	Token            string `json:"token"`
+	HeartbeatSeconds int    `json:"heartbeat_seconds"`
+}
+
+// authHandler implements the handshake: a client POSTs a bearer credential
+// (or public key, depending on the configured Authenticator) and gets back
+// an opaque session token plus the heartbeat interval it should expect on
+// the SSE streams.
+func authHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req authRequest
+	json.NewDecoder(r.Body).Decode(&req) // malformed/empty body just means no credential
+
+	if req.Credential == "" {
+		req.Credential = bearerToken(r)
+	}
+
+	topics, err := authenticator.Authenticate(req.Credential)
+	if err != nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sess, err := sessions.create(topics, defaultHeartbeat)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(authResponse{
+		Token:            sess.subKey,
+		HeartbeatSeconds: int(sess.heartbeat / time.Second),
+	})
+}
+
+// bearerToken extracts a token from the Authorization header, if present.
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return auth
+	}
+	return strings.TrimPrefix(auth, "Bearer ")
+}
+
+// sessionForRequest resolves the session token from the Authorization
+// header or a "token" query param, falling back across both so browser
+// EventSource clients (which can't set custom headers) can authenticate via
+// the query string.
+func sessionForRequest(r *http.Request) (*session, bool) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = bearerToken(r)
+	}
+	if token == "" {
+		return nil, false
+	}
+	return sessions.get(token)
+}
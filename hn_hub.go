@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/drowsyrobotboy/illu/hnfetch"
+)
+
+const (
+	hnPollInterval      = 120 * time.Second
+	hnInitialStoryLimit = 10 // Send up to 10 initial stories
+	hnMaxDeltaPerTick   = 5
+	hnRingSize          = hnInitialStoryLimit
+	hnFetchTimeout      = 20 * time.Second
+)
+
+// frameRing is a bounded FIFO of the most recently broadcast frames. It lets
+// a client that joins after the hub has already been running replay recent
+// history without the hub making an extra round-trip to HN on its behalf.
+type frameRing struct {
+	mu     sync.Mutex
+	frames []frame
+	size   int
+}
+
+func newFrameRing(size int) *frameRing {
+	return &frameRing{size: size}
+}
+
+func (r *frameRing) add(f frame) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.frames = append(r.frames, f)
+	if len(r.frames) > r.size {
+		r.frames = r.frames[len(r.frames)-r.size:]
+	}
+}
+
+// snapshot returns the frames currently held, oldest first.
+func (r *frameRing) snapshot() []frame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]frame, len(r.frames))
+	copy(out, r.frames)
+	return out
+}
+
+// HNHub polls the Hacker News Firebase API on a single ticker and fans the
+// resulting SSE frames out to every subscribed /hn-events client. It owns
+// the set of story IDs already pushed (previously the package-level
+// lastSentStoryIDs) and a small ring of recent frames for replaying history
+// to late joiners. Item bodies are fetched through an hnfetch.Fetcher, which
+// handles concurrency, retries, and caching on our behalf.
+type HNHub struct {
+	*Hub
+
+	client  *http.Client
+	fetcher *hnfetch.Fetcher
+
+	sentIDs map[int]struct{}
+	recent  *frameRing
+
+	// publishMu serializes "add to ring + broadcast" against "snapshot
+	// ring + subscribe" so a story published concurrently with a client
+	// joining is delivered to that client exactly once: either it's
+	// already in the replay snapshot, or it arrives on the subscriber
+	// channel, never both.
+	publishMu sync.Mutex
+}
+
+func newHNHub() *HNHub {
+	return &HNHub{
+		Hub:     newHub(16),
+		client:  &http.Client{Timeout: 10 * time.Second},
+		fetcher: hnfetch.New(hnfetch.DefaultConfig()),
+		sentIDs: make(map[int]struct{}),
+		recent:  newFrameRing(hnRingSize),
+	}
+}
+
+// publish records f in the replay ring and broadcasts it to subscribers as
+// a single atomic step with respect to subscribeWithReplay.
+func (h *HNHub) publish(f frame) {
+	h.publishMu.Lock()
+	defer h.publishMu.Unlock()
+	h.recent.add(f)
+	h.broadcast(f)
+}
+
+// subscribeWithReplay atomically registers a new client and captures the
+// current replay snapshot, so a story published concurrently can't be
+// delivered to the new client both via replay and via its subscriber
+// channel.
+func (h *HNHub) subscribeWithReplay() (chan frame, []frame) {
+	h.publishMu.Lock()
+	defer h.publishMu.Unlock()
+	return h.subscribe(), h.recent.snapshot()
+}
+
+// run drives the hub for the lifetime of the process: an initial batch on
+// startup, then one delta poll per tick until stop is closed. It's meant to
+// be started exactly once, as its own goroutine.
+func (h *HNHub) run(stop <-chan struct{}) {
+	h.pollInitial()
+
+	ticker := time.NewTicker(hnPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.pollDelta()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// fetchTopStoryIDs fetches the current top story ID list from HN.
+func (h *HNHub) fetchTopStoryIDs() ([]int, error) {
+	resp, err := h.client.Get("https://hacker-news.firebaseio.com/v0/topstories.json?print=pretty")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ids []int
+	if err := json.NewDecoder(resp.Body).Decode(&ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// storyFrame encodes a story as an SSE "new-story" frame.
+func storyFrame(story hnfetch.HNStory) (frame, error) {
+	storyJSON, err := json.Marshal(story)
+	if err != nil {
+		return nil, err
+	}
+	var buf []byte
+	buf = append(buf, fmt.Sprintf("id: %d\n", story.ID)...)
+	buf = append(buf, "event: new-story\n"...)
+	buf = append(buf, fmt.Sprintf("data: %s\n\n", storyJSON)...)
+	return buf, nil
+}
+
+// pollInitial fetches the current top stories once on startup and
+// broadcasts (and remembers, for replay) the ones worth showing.
+func (h *HNHub) pollInitial() {
+	logger.Info("fetching initial batch of hn stories")
+
+	ids, err := h.fetchTopStoryIDs()
+	if err != nil {
+		logger.Error("fetch initial top story ids failed", "err", err)
+		return
+	}
+	if len(ids) > hnInitialStoryLimit {
+		ids = ids[:hnInitialStoryLimit]
+	}
+
+	h.fetchAndPublishAll(ids)
+}
+
+// pollDelta fetches the current top stories and publishes only the ones the
+// hub hasn't already sent.
+func (h *HNHub) pollDelta() {
+	logger.Debug("checking for delta hn stories")
+
+	ids, err := h.fetchTopStoryIDs()
+	if err != nil {
+		logger.Error("fetch top story ids for delta failed", "err", err)
+		return
+	}
+
+	var newIDs []int
+	for _, id := range ids {
+		if _, seen := h.sentIDs[id]; !seen {
+			newIDs = append(newIDs, id)
+		}
+		h.sentIDs[id] = struct{}{}
+	}
+
+	if len(newIDs) == 0 {
+		logger.Debug("no new delta hn stories found")
+		return
+	}
+	if len(newIDs) > hnMaxDeltaPerTick {
+		newIDs = newIDs[:hnMaxDeltaPerTick]
+	}
+
+	logger.Info("found delta hn stories", "count", len(newIDs))
+	h.fetchAndPublishAll(newIDs)
+}
+
+// fetchAndPublishAll fetches ids concurrently through the hub's Fetcher and
+// broadcasts (and remembers, for replay) each result as it arrives, rather
+// than waiting for the slowest item before sending any of them.
+func (h *HNHub) fetchAndPublishAll(ids []int) {
+	ctx, cancel := context.WithTimeout(context.Background(), hnFetchTimeout)
+	defer cancel()
+
+	for res := range h.fetcher.Fetch(ctx, ids) {
+		// Mark as sent regardless of outcome: a permanently broken or
+		// non-story item should not be retried by the next delta tick.
+		// This also covers the initial batch, so the first delta tick
+		// doesn't treat already-sent stories as new.
+		h.sentIDs[res.ID] = struct{}{}
+
+		if res.Err != nil {
+			logger.Warn("fetch story failed", "id", res.ID, "err", res.Err)
+			continue
+		}
+
+		story := res.Story
+		if story.Type != "story" || story.Title == "" || story.URL == "" {
+			logger.Debug("skipping non-story or incomplete item", "id", story.ID, "type", story.Type)
+			continue
+		}
+
+		f, err := storyFrame(story)
+		if err != nil {
+			logger.Warn("marshal story failed", "id", story.ID, "err", err)
+			continue
+		}
+
+		h.publish(f)
+		logger.Info("sent story", "id", story.ID, "title", story.Title)
+	}
+}
@@ -0,0 +1,271 @@
+// Package hnfetch fetches Hacker News items concurrently. It borrows the
+// shape of Docker's transfer/download manager: a bounded worker pool shares
+// one HTTP client, in-flight requests for the same ID are deduplicated so
+// concurrent callers share a single upstream fetch, transient failures are
+// retried with exponential backoff and jitter, and successful responses are
+// cached for a short TTL so repeated polls don't re-fetch unchanged items.
+package hnfetch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HNStory is a simplified Hacker News item.
+type HNStory struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	By    string `json:"by"`
+	Score int    `json:"score"`
+	Type  string `json:"type"`
+}
+
+// Result is delivered on the channel returned by Fetcher.Fetch, one per
+// requested ID; an ID not yet handed to a worker when ctx is done gets none.
+type Result struct {
+	ID    int
+	Story HNStory
+	Err   error
+}
+
+// Config controls a Fetcher's concurrency, retry, and caching behavior.
+type Config struct {
+	// Workers bounds how many items are fetched concurrently.
+	Workers int
+	// MaxRetries is the number of retry attempts for a 5xx or timeout
+	// response before giving up.
+	MaxRetries int
+	// RetryBaseDelay is the base of the exponential backoff between
+	// retries; actual delay also gets jitter added.
+	RetryBaseDelay time.Duration
+	// RequestTimeout bounds a single HTTP round-trip.
+	RequestTimeout time.Duration
+	// BaseURL is the HN Firebase API root, overridable in tests.
+	BaseURL string
+	// CacheSize is the maximum number of items the LRU cache holds.
+	CacheSize int
+	// CacheTTL is how long a cached item is served before being
+	// considered stale and re-fetched.
+	CacheTTL time.Duration
+}
+
+// DefaultConfig returns the settings illu uses in production.
+func DefaultConfig() Config {
+	return Config{
+		Workers:        8,
+		MaxRetries:     3,
+		RetryBaseDelay: 200 * time.Millisecond,
+		RequestTimeout: 10 * time.Second,
+		BaseURL:        "https://hacker-news.firebaseio.com/v0",
+		CacheSize:      512,
+		CacheTTL:       60 * time.Second,
+	}
+}
+
+// inflight tracks a fetch that's already underway for a given item ID, so
+// concurrent callers asking for the same ID share one upstream request
+// instead of each issuing their own.
+type inflight struct {
+	done chan struct{}
+	res  Result
+}
+
+// Fetcher fetches HN items through a bounded worker pool, deduplicating and
+// caching as it goes. The zero value is not usable; construct one with New.
+type Fetcher struct {
+	cfg    Config
+	client *http.Client
+
+	mu       sync.Mutex
+	inflight map[int]*inflight
+	cache    *lruCache
+}
+
+// New builds a Fetcher from cfg. Zero-valued fields in cfg fall back to
+// DefaultConfig's values, except MaxRetries: zero means no retries, and only
+// a negative MaxRetries falls back to the default.
+func New(cfg Config) *Fetcher {
+	def := DefaultConfig()
+	if cfg.Workers <= 0 {
+		cfg.Workers = def.Workers
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = def.MaxRetries
+	}
+	if cfg.RetryBaseDelay <= 0 {
+		cfg.RetryBaseDelay = def.RetryBaseDelay
+	}
+	if cfg.RequestTimeout <= 0 {
+		cfg.RequestTimeout = def.RequestTimeout
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = def.BaseURL
+	}
+	if cfg.CacheSize <= 0 {
+		cfg.CacheSize = def.CacheSize
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = def.CacheTTL
+	}
+
+	return &Fetcher{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: cfg.RequestTimeout,
+			Transport: &http.Transport{
+				MaxIdleConns:        cfg.Workers * 2,
+				MaxIdleConnsPerHost: cfg.Workers * 2,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+		inflight: make(map[int]*inflight),
+		cache:    newLRUCache(cfg.CacheSize),
+	}
+}
+
+// Fetch fetches ids through a bounded worker pool and returns a channel
+// delivering one Result per ID, in no particular order. The channel is
+// closed once every ID has been delivered or ctx is done.
+func (f *Fetcher) Fetch(ctx context.Context, ids []int) <-chan Result {
+	out := make(chan Result, len(ids))
+	if len(ids) == 0 {
+		close(out)
+		return out
+	}
+
+	jobs := make(chan int)
+	workers := f.cfg.Workers
+	if workers > len(ids) {
+		workers = len(ids)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for id := range jobs {
+				story, err := f.fetchOne(ctx, id)
+				out <- Result{ID: id, Story: story, Err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, id := range ids {
+			select {
+			case jobs <- id:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// fetchOne resolves a single ID via cache, in-flight dedup, or a fresh
+// (retried) HTTP fetch, in that order.
+func (f *Fetcher) fetchOne(ctx context.Context, id int) (HNStory, error) {
+	if story, ok := f.cache.get(id); ok {
+		return story, nil
+	}
+
+	f.mu.Lock()
+	if inf, ok := f.inflight[id]; ok {
+		f.mu.Unlock()
+		select {
+		case <-inf.done:
+			return inf.res.Story, inf.res.Err
+		case <-ctx.Done():
+			return HNStory{}, ctx.Err()
+		}
+	}
+
+	inf := &inflight{done: make(chan struct{})}
+	f.inflight[id] = inf
+	f.mu.Unlock()
+
+	story, err := f.fetchWithRetry(ctx, id)
+
+	f.mu.Lock()
+	delete(f.inflight, id)
+	f.mu.Unlock()
+
+	inf.res = Result{ID: id, Story: story, Err: err}
+	close(inf.done)
+
+	if err == nil {
+		f.cache.set(id, story, f.cfg.CacheTTL)
+	}
+	return story, err
+}
+
+// fetchWithRetry fetches a single item, retrying 5xx and timeout errors
+// with exponential backoff and jitter.
+func (f *Fetcher) fetchWithRetry(ctx context.Context, id int) (HNStory, error) {
+	var lastErr error
+	for attempt := 0; attempt <= f.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			delay := f.cfg.RetryBaseDelay * time.Duration(1<<uint(attempt-1))
+			delay += time.Duration(rand.Int63n(int64(f.cfg.RetryBaseDelay) + 1))
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return HNStory{}, ctx.Err()
+			}
+		}
+
+		story, retryable, err := f.fetchItem(ctx, id)
+		if err == nil {
+			return story, nil
+		}
+		lastErr = err
+		if !retryable {
+			return HNStory{}, err
+		}
+	}
+	return HNStory{}, fmt.Errorf("hnfetch: item %d: giving up after %d attempts: %w", id, f.cfg.MaxRetries+1, lastErr)
+}
+
+// fetchItem performs one HTTP round-trip for item id. The bool return
+// reports whether a failed attempt is worth retrying (5xx, timeout,
+// connection errors) as opposed to a permanent failure (bad JSON).
+func (f *Fetcher) fetchItem(ctx context.Context, id int) (HNStory, bool, error) {
+	url := fmt.Sprintf("%s/item/%d.json", f.cfg.BaseURL, id)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return HNStory{}, false, err
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return HNStory{}, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return HNStory{}, true, fmt.Errorf("hnfetch: item %d: server error %d", id, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return HNStory{}, false, fmt.Errorf("hnfetch: item %d: unexpected status %d", id, resp.StatusCode)
+	}
+
+	var story HNStory
+	if err := json.NewDecoder(resp.Body).Decode(&story); err != nil {
+		return HNStory{}, false, fmt.Errorf("hnfetch: item %d: decode: %w", id, err)
+	}
+	return story, false, nil
+}
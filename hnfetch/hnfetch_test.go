@@ -0,0 +1,161 @@
+package hnfetch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testConfig(baseURL string) Config {
+	cfg := DefaultConfig()
+	cfg.BaseURL = baseURL
+	cfg.Workers = 4
+	cfg.RetryBaseDelay = time.Millisecond
+	cfg.RequestTimeout = time.Second
+	return cfg
+}
+
+func TestFetchRetriesOn5xxThenSucceeds(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if n < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(HNStory{ID: 1, Title: "ok", URL: "https://example.com", Type: "story"})
+	}))
+	defer srv.Close()
+
+	f := New(testConfig(srv.URL))
+	results := collect(t, f.Fetch(context.Background(), []int{1}))
+
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+	if results[0].Err != nil {
+		t.Fatalf("expected success after retries, got err: %v", results[0].Err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Fatalf("expected 3 upstream calls (2 failures + 1 success), got %d", got)
+	}
+}
+
+func TestFetchGivesUpAfterMaxRetries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig(srv.URL)
+	cfg.MaxRetries = 2
+	f := New(cfg)
+
+	results := collect(t, f.Fetch(context.Background(), []int{1}))
+	if results[0].Err == nil {
+		t.Fatal("expected an error after exhausting retries")
+	}
+	if got := atomic.LoadInt32(&calls); got != int32(cfg.MaxRetries+1) {
+		t.Fatalf("expected %d upstream calls, got %d", cfg.MaxRetries+1, got)
+	}
+}
+
+func TestFetchDeduplicatesInFlightRequests(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		json.NewEncoder(w).Encode(HNStory{ID: 42, Title: "dedup", URL: "https://example.com", Type: "story"})
+	}))
+	defer srv.Close()
+
+	f := New(testConfig(srv.URL))
+
+	done := make(chan []Result, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			done <- collect(t, f.Fetch(context.Background(), []int{42}))
+		}()
+	}
+
+	// Give both callers a chance to register as in-flight before the
+	// handler is allowed to respond.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < 2; i++ {
+		results := <-done
+		if results[0].Err != nil {
+			t.Fatalf("unexpected error: %v", results[0].Err)
+		}
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("expected exactly 1 upstream call for two concurrent fetches of the same ID, got %d", got)
+	}
+}
+
+func TestFetchRespectsContextCancellation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	f := New(testConfig(srv.URL))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	results := collect(t, f.Fetch(ctx, []int{1, 2, 3}))
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Fetch did not respect context cancellation, took %s", elapsed)
+	}
+
+	for _, r := range results {
+		if r.Err == nil {
+			t.Fatalf("expected cancellation error for id %d, got success", r.ID)
+		}
+	}
+}
+
+func collect(t *testing.T, ch <-chan Result) []Result {
+	t.Helper()
+	var out []Result
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case r, ok := <-ch:
+			if !ok {
+				return out
+			}
+			out = append(out, r)
+		case <-timeout:
+			t.Fatal("timed out waiting for fetch results")
+		}
+	}
+}
+
+func ExampleFetcher_Fetch() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(HNStory{ID: 1, Title: "example", URL: "https://example.com", Type: "story"})
+	}))
+	defer srv.Close()
+
+	f := New(testConfig(srv.URL))
+	for r := range f.Fetch(context.Background(), []int{1}) {
+		fmt.Println(r.Story.Title)
+	}
+	// Output: example
+}
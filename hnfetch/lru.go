@@ -0,0 +1,76 @@
+package hnfetch
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// lruCache is a small, TTL-aware LRU keyed by HN item ID. It exists so that
+// repeated polls of the same top-stories list don't re-fetch items that
+// haven't changed since the last tick.
+type lruCache struct {
+	mu       sync.Mutex
+	cap      int
+	ll       *list.List
+	elements map[int]*list.Element
+}
+
+type lruEntry struct {
+	id        int
+	story     HNStory
+	expiresAt time.Time
+}
+
+func newLRUCache(capacity int) *lruCache {
+	return &lruCache{
+		cap:      capacity,
+		ll:       list.New(),
+		elements: make(map[int]*list.Element),
+	}
+}
+
+func (c *lruCache) get(id int) (HNStory, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.elements[id]
+	if !ok {
+		return HNStory{}, false
+	}
+	entry := el.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.ll.Remove(el)
+		delete(c.elements, id)
+		return HNStory{}, false
+	}
+
+	c.ll.MoveToFront(el)
+	return entry.story, true
+}
+
+func (c *lruCache) set(id int, story HNStory, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.elements[id]; ok {
+		entry := el.Value.(*lruEntry)
+		entry.story = story
+		entry.expiresAt = time.Now().Add(ttl)
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	entry := &lruEntry{id: id, story: story, expiresAt: time.Now().Add(ttl)}
+	el := c.ll.PushFront(entry)
+	c.elements[id] = el
+
+	for c.ll.Len() > c.cap {
+		oldest := c.ll.Back()
+		if oldest == nil {
+			break
+		}
+		c.ll.Remove(oldest)
+		delete(c.elements, oldest.Value.(*lruEntry).id)
+	}
+}
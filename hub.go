@@ -0,0 +1,64 @@
+package main
+
+import "sync"
+
+// frame is a single pre-encoded SSE payload, ready to be written straight to
+// a client's http.ResponseWriter.
+type frame []byte
+
+// Hub fans a single stream of SSE frames out to any number of connected
+// clients. There is exactly one Hub per stream (stats, hn) no matter how
+// many clients are subscribed to it, so the expensive work of producing a
+// frame (sampling gopsutil, polling the HN API) happens once per tick
+// regardless of N.
+type Hub struct {
+	mu      sync.Mutex
+	clients map[chan frame]struct{}
+
+	// bufSize bounds how many frames a subscriber channel may queue before
+	// it's considered slow and dropped, so one stuck client can never
+	// block the publisher or the other subscribers.
+	bufSize int
+}
+
+func newHub(bufSize int) *Hub {
+	return &Hub{
+		clients: make(map[chan frame]struct{}),
+		bufSize: bufSize,
+	}
+}
+
+// subscribe registers a new client and returns the channel it should read
+// frames from. The caller must call unsubscribe once it's done reading,
+// typically when r.Context().Done() fires.
+func (h *Hub) subscribe() chan frame {
+	ch := make(chan frame, h.bufSize)
+	h.mu.Lock()
+	h.clients[ch] = struct{}{}
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *Hub) unsubscribe(ch chan frame) {
+	h.mu.Lock()
+	if _, ok := h.clients[ch]; ok {
+		delete(h.clients, ch)
+		close(ch)
+	}
+	h.mu.Unlock()
+}
+
+// broadcast fans f out to every subscribed client. A client whose buffer is
+// already full is dropped rather than allowed to stall the publisher.
+func (h *Hub) broadcast(f frame) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.clients {
+		select {
+		case ch <- f:
+		default:
+			delete(h.clients, ch)
+			close(ch)
+		}
+	}
+}
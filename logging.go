@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"os"
+)
+
+// logger is the process-wide structured logger. main() replaces it (before
+// starting any goroutines) based on the -log-level / -log-format flags;
+// this default just keeps the package usable before that happens.
+var logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+// newLogger builds a logger from the given level name ("debug", "info",
+// "warn", "error") and format ("text" for local dev, "json" for
+// production). An unrecognized level falls back to info.
+func newLogger(level, format string) *slog.Logger {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		lvl = slog.LevelInfo
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var handler slog.Handler
+	if format == "json" {
+		handler = slog.NewJSONHandler(os.Stdout, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	return slog.New(handler)
+}
+
+// newClientID returns a short opaque identifier for correlating the log
+// lines belonging to a single SSE connection.
+func newClientID() string {
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
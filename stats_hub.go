@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/shirou/gopsutil/disk"
+	"github.com/shirou/gopsutil/load"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// StatsHub samples host stats on a single ticker and broadcasts the encoded
+// SSE frame to every subscribed /stats client.
+type StatsHub struct {
+	*Hub
+	interval time.Duration
+}
+
+func newStatsHub(interval time.Duration) *StatsHub {
+	return &StatsHub{
+		Hub:      newHub(8),
+		interval: interval,
+	}
+}
+
+// run samples stats once per interval until stop is closed. It's meant to be
+// started exactly once, as its own goroutine, for the lifetime of the
+// process.
+func (h *StatsHub) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		h.broadcast(frame(encodeStatsFrame()))
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func encodeStatsFrame() []byte {
+	cpuPercent, _ := cpu.Percent(0, false)
+	cpuCores, _ := cpu.Counts(true)
+	loadAvg, _ := load.Avg()
+	vmem, _ := mem.VirtualMemory()
+	swap, _ := mem.SwapMemory()
+	sensors, _ := host.SensorsTemperatures()
+	diskUsage, _ := disk.Usage("/")
+
+	temp := 0.0
+	for _, s := range sensors {
+		if s.SensorKey == "Package id 0" || s.SensorKey == "Tdie" || s.SensorKey == "coretemp" {
+			temp = s.Temperature
+			break
+		}
+	}
+
+	var cpuPct float64
+	if len(cpuPercent) > 0 {
+		cpuPct = cpuPercent[0]
+	}
+
+	stats := Stats{
+		CPUPercent: cpuPct,
+		CPUCores:   cpuCores,
+		Load1:      loadAvg.Load1,
+		Load5:      loadAvg.Load5,
+		Load15:     loadAvg.Load15,
+
+		MemoryUsed:    vmem.Used / (1024 * 1024),
+		MemoryTotal:   vmem.Total / (1024 * 1024),
+		MemoryPercent: vmem.UsedPercent,
+
+		SwapUsed:    swap.Used / (1024 * 1024),
+		SwapTotal:   swap.Total / (1024 * 1024),
+		SwapPercent: swap.UsedPercent,
+
+		TempC: temp,
+
+		DiskUsed:    diskUsage.Used / (1024 * 1024),
+		DiskTotal:   diskUsage.Total / (1024 * 1024),
+		DiskPercent: diskUsage.UsedPercent,
+	}
+
+	jsonData, _ := json.Marshal(stats)
+	return []byte(fmt.Sprintf("data: %s\n\n", jsonData))
+}